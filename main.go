@@ -2,20 +2,40 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/docker/go-units"
 	"github.com/pterm/pterm"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -23,10 +43,94 @@ const (
 	SpotTolerationValue = "spot"
 )
 
+// Valid values for the --sort-by flag.
+const (
+	SortByCPUNodeUtil  = "cpu-node-util"
+	SortByMemNodeUtil  = "mem-node-util"
+	SortByCPULimitUtil = "cpu-limit-util"
+)
+
 var (
 	nodeName string
+
+	showUtilization bool
+	sortBy          string
+
+	watchFlag     bool
+	watchInterval time.Duration
+
+	outputFlag string
+	listenFlag string
+
+	concurrencyFlag int
+	timeoutFlag     time.Duration
+
+	namespaceFlag     string
+	allNamespacesFlag bool
+	selectorFlag      string
+	fieldSelectorFlag string
+)
+
+// podResourcesSocket is the kubelet gRPC socket ktop queries for exclusive CPU sets and
+// device IDs. Only reachable when ktop runs on the node it's reporting on (e.g. as a
+// DaemonSet), so a dial failure just means those columns are omitted.
+const podResourcesSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+// Valid values for the --output flag.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputProm  = "prom"
 )
 
+// ResourceValues is the CPU/memory pair used throughout the structured output schema.
+type ResourceValues struct {
+	CPUMilli    int64 `json:"cpuMilli" yaml:"cpuMilli"`
+	MemoryBytes int64 `json:"memoryBytes" yaml:"memoryBytes"`
+}
+
+// ContainerResult is one container's metrics in the --output=json|yaml schema.
+type ContainerResult struct {
+	Name           string         `json:"name" yaml:"name"`
+	Usage          ResourceValues `json:"usage" yaml:"usage"`
+	Requests       ResourceValues `json:"requests" yaml:"requests"`
+	Limits         ResourceValues `json:"limits" yaml:"limits"`
+	SpotToleration bool           `json:"spotToleration" yaml:"spotToleration"`
+	ExclusiveCPUs  string         `json:"exclusiveCpus,omitempty" yaml:"exclusiveCpus,omitempty"`
+	DeviceIDs      string         `json:"deviceIds,omitempty" yaml:"deviceIds,omitempty"`
+}
+
+// PodResult groups a pod's containers in the --output=json|yaml schema.
+type PodResult struct {
+	Namespace       string            `json:"namespace" yaml:"namespace"`
+	Name            string            `json:"name" yaml:"name"`
+	QOSClass        string            `json:"qosClass,omitempty" yaml:"qosClass,omitempty"`
+	HasNodeSelector bool              `json:"hasNodeSelector,omitempty" yaml:"hasNodeSelector,omitempty"`
+	HasNodeAffinity bool              `json:"hasNodeAffinity,omitempty" yaml:"hasNodeAffinity,omitempty"`
+	Containers      []ContainerResult `json:"containers" yaml:"containers"`
+}
+
+// NodeResult is one node's capacity/allocatable and its pods in the --output=json|yaml schema.
+type NodeResult struct {
+	Name        string         `json:"name" yaml:"name"`
+	Capacity    ResourceValues `json:"capacity" yaml:"capacity"`
+	Allocatable ResourceValues `json:"allocatable" yaml:"allocatable"`
+	Pods        []PodResult    `json:"pods" yaml:"pods"`
+}
+
+// ClusterResult is one cluster's nodes in the --output=json|yaml schema. Name is the
+// kubeconfig context, empty when ktop is talking to its current/in-cluster context.
+type ClusterResult struct {
+	Name  string       `json:"name,omitempty" yaml:"name,omitempty"`
+	Nodes []NodeResult `json:"nodes" yaml:"nodes"`
+}
+
+// StructuredOutput is the top-level document emitted by --output=json|yaml.
+type StructuredOutput struct {
+	Clusters []ClusterResult `json:"clusters" yaml:"clusters"`
+}
+
 func printHelp() {
 	pterm.Println("Display node capacity and pods metrics, if toleration is set, it will be displayed.")
 	pterm.Println("Usage:")
@@ -35,19 +139,51 @@ func printHelp() {
 	pterm.Println("Flags:")
 	pterm.Println("  [Node],  Node name")
 	pterm.Println("  -h,  help for klog")
+	pterm.Println("  --show-utilization,  Add CPU/mem usage as a % of node capacity and of request/limit")
+	pterm.Println("  --sort-by,  Sort containers by utilization: cpu-node-util|mem-node-util|cpu-limit-util")
+	pterm.Println("  --watch, -w,  Continuously refresh metrics like top")
+	pterm.Println("  --interval,  Refresh interval used by --watch (default 2s)")
+	pterm.Println("  --context,  Kubeconfig context(s) to use: a name, \"all\", or a comma-separated list")
+	pterm.Println("  --kubeconfig,  Path(s) to a kubeconfig file (colon-separated), overrides $KUBECONFIG")
+	pterm.Println("  --output,  Output format: table|json|yaml|prom (default table)")
+	pterm.Println("  --listen,  With --output=prom, serve metrics over HTTP at this address instead of printing once")
+	pterm.Println("  --concurrency,  Max concurrent per-pod metrics fetches and concurrent node collection (default 16)")
+	pterm.Println("  --timeout,  Deadline for fetching pods and metrics before giving up (default 30s)")
+	pterm.Println("  --namespace, -n,  Only show pods in this namespace")
+	pterm.Println("  --all-namespaces, -A,  Show pods across all namespaces (default)")
+	pterm.Println("  --selector, -l,  Label selector to filter pods by (e.g. app=web)")
+	pterm.Println("  --field-selector,  Field selector to filter pods by, ANDed with the node filter")
 	pterm.Println("Examples:")
 	pterm.Println("  klog / Show all nodes and pods metrics")
 	pterm.Println("  klog my-node / Show specified node and pods metrics")
+	pterm.Println("  klog --show-utilization --sort-by=cpu-limit-util / Show hottest containers first")
+	pterm.Println("  klog --watch --interval=5s / Refresh metrics every 5 seconds")
+	pterm.Println("  klog --context=all / Show metrics for every cluster in the kubeconfig")
+	pterm.Println("  klog --output=json | jq . / Pipe structured output into jq")
+	pterm.Println("  klog --output=prom --listen=:9095 / Serve metrics as a Prometheus exporter")
+	pterm.Println("  klog -n kube-system -l app=metrics-server / Show pods in one namespace matching a label selector")
 }
 
 func main() {
-	// Start spinner
-	spinner, _ := pterm.DefaultSpinner.Start("Initialization running")
-
-	// Initialize an array to store errors
-	var errorsList []error
-
 	helpFlag := flag.Bool("h", false, "Show help message")
+	flag.BoolVar(&showUtilization, "show-utilization", false, "Add CPU/mem usage as a % of node capacity and of request/limit")
+	flag.StringVar(&sortBy, "sort-by", "", "Sort containers by utilization: cpu-node-util|mem-node-util|cpu-limit-util")
+	flag.BoolVar(&watchFlag, "watch", false, "Continuously refresh metrics like top")
+	flag.BoolVar(&watchFlag, "w", false, "Shorthand for --watch")
+	flag.DurationVar(&watchInterval, "interval", 2*time.Second, "Refresh interval used by --watch")
+	contextFlag := flag.String("context", "", `Kubeconfig context(s) to use: a name, "all", or a comma-separated list`)
+	kubeconfigFlag := flag.String("kubeconfig", "", "Path(s) to a kubeconfig file (colon-separated), overrides $KUBECONFIG")
+	flag.StringVar(&outputFlag, "output", OutputTable, "Output format: table|json|yaml|prom")
+	flag.StringVar(&listenFlag, "listen", "", "With --output=prom, serve metrics over HTTP at this address (e.g. :9095) instead of printing once")
+	flag.IntVar(&concurrencyFlag, "concurrency", 16, "Max concurrent per-pod metrics fetches and concurrent node collection")
+	flag.DurationVar(&timeoutFlag, "timeout", 30*time.Second, "Deadline for fetching pods and metrics before giving up")
+	flag.StringVar(&namespaceFlag, "namespace", "", "Only show pods in this namespace")
+	flag.StringVar(&namespaceFlag, "n", "", "Shorthand for --namespace")
+	flag.BoolVar(&allNamespacesFlag, "all-namespaces", false, "Show pods across all namespaces (default)")
+	flag.BoolVar(&allNamespacesFlag, "A", false, "Shorthand for --all-namespaces")
+	flag.StringVar(&selectorFlag, "selector", "", "Label selector to filter pods by (e.g. app=web)")
+	flag.StringVar(&selectorFlag, "l", "", "Shorthand for --selector")
+	flag.StringVar(&fieldSelectorFlag, "field-selector", "", "Field selector to filter pods by, ANDed with the node filter")
 
 	flag.Parse()
 	nodeFlag := flag.Arg(0)
@@ -57,42 +193,146 @@ func main() {
 		os.Exit(0)
 	}
 
+	if namespaceFlag != "" && allNamespacesFlag {
+		pterm.Error.Println("--namespace and --all-namespaces are mutually exclusive")
+		os.Exit(1)
+	}
+
+	if concurrencyFlag <= 0 {
+		pterm.Error.Println("--concurrency must be greater than 0")
+		os.Exit(1)
+	}
+
 	// Check if a non-flag argument is passed
 	if nodeFlag != "" {
 		nodeName = nodeFlag
 	}
 
-	config, err := loadKubeConfig()
-	ctx := context.Background()
+	// Start spinner (suppressed when stdout isn't a terminal, e.g. piped into jq)
+	spinner := startSpinner("Initialization running")
 
+	contexts, err := resolveContexts(*contextFlag, *kubeconfigFlag)
 	if err != nil {
-		spinner.Fail("Initialization error")
-		pterm.Error.Printf("Error loading Kubernetes configuration: %v\n", err)
+		spinnerFail(spinner, "Initialization error")
+		pterm.Error.Printf("Error resolving kubeconfig contexts: %v\n", err)
+		os.Exit(1)
+	}
+
+	if watchFlag && len(contexts) > 1 {
+		spinnerFail(spinner, "Initialization error")
+		pterm.Error.Println("--watch only supports a single cluster; pass a single --context")
+		os.Exit(1)
+	}
+
+	if watchFlag && outputFlag != OutputTable {
+		spinnerFail(spinner, "Initialization error")
+		pterm.Error.Println("--watch only supports --output=table")
+		os.Exit(1)
+	}
+
+	if watchFlag && fieldSelectorFlag != "" {
+		spinnerFail(spinner, "Initialization error")
+		pterm.Error.Println("--watch does not support --field-selector, since the informer cache can't evaluate it")
 		os.Exit(1)
 	}
 
+	// Stop spinner
+	spinnerSuccess(spinner, "Initialization done")
+
+	if outputFlag != OutputTable {
+		if err := runStructuredOutput(contexts, *kubeconfigFlag); err != nil {
+			pterm.Error.Printf("Error producing %s output: %v\n", outputFlag, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var anySucceeded bool
+	for _, contextName := range contexts {
+		if err := runCluster(contextName, *kubeconfigFlag, len(contexts) > 1); err != nil {
+			pterm.Error.Printf("Error on cluster %q: %v\n", clusterLabel(contextName), err)
+			continue
+		}
+		anySucceeded = true
+	}
+
+	if !anySucceeded {
+		os.Exit(1)
+	}
+}
+
+// isTerminalStdout reports whether stdout is an interactive terminal, so spinners and
+// progress bars can be suppressed automatically when ktop's output is piped or redirected.
+func isTerminalStdout() bool {
+	stat, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// startSpinner starts the initialization spinner, or returns nil when stdout isn't a
+// terminal so no animation is written into piped/redirected output.
+func startSpinner(text string) *pterm.SpinnerPrinter {
+	if !isTerminalStdout() {
+		return nil
+	}
+	spinner, _ := pterm.DefaultSpinner.Start(text)
+	return spinner
+}
+
+// spinnerFail reports a failure on a possibly-nil spinner (nil when stdout isn't a terminal).
+func spinnerFail(spinner *pterm.SpinnerPrinter, text string) {
+	if spinner != nil {
+		spinner.Fail(text)
+		return
+	}
+	pterm.Error.Println(text)
+}
+
+// spinnerSuccess reports success on a possibly-nil spinner (nil when stdout isn't a terminal).
+func spinnerSuccess(spinner *pterm.SpinnerPrinter, text string) {
+	if spinner != nil {
+		spinner.Success(text)
+	}
+}
+
+// clusterLabel returns a human-readable name for a (possibly empty, meaning
+// current/in-cluster) kubeconfig context, for use in headers and error messages.
+func clusterLabel(contextName string) string {
+	if contextName == "" {
+		return "current"
+	}
+	return contextName
+}
+
+// runCluster connects to a single cluster context and renders its metrics, either once
+// or continuously if --watch is set. printHeader is set when fanning out across multiple
+// clusters, so each cluster's tables are preceded by a header identifying it.
+func runCluster(contextName, kubeconfigOverride string, printHeader bool) error {
+	ctx := context.Background()
+
+	config, err := loadKubeConfig(kubeconfigOverride, contextName)
+	if err != nil {
+		return fmt.Errorf("loading Kubernetes configuration: %w", err)
+	}
+
 	// Create the Kubernetes API clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		spinner.Fail("Initialization error")
-		pterm.Error.Printf("Error creating Kubernetes client: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("creating Kubernetes client: %w", err)
 	}
 
 	// Create the Kubernetes metrics clientset
 	metricsClientset, err := metricsv.NewForConfig(config)
 	if err != nil {
-		spinner.Fail("Initialization error")
-		pterm.Error.Printf("Error creating Kubernetes metrics clientset: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("creating Kubernetes metrics client: %w", err)
 	}
 
 	// Retrieve the list of nodes
 	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		spinner.Fail("Initialization error")
-		pterm.Error.Printf("Error retrieving nodes: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("retrieving nodes: %w", err)
 	}
 
 	// Find the node by its name
@@ -104,33 +344,430 @@ func main() {
 		}
 	}
 
-	// Stop spinner
-	spinner.Success("Initialization done")
-
+	var nodesToShow []corev1.Node
 	if foundNode == nil {
-		// Display metrics for each node
-		for _, node := range nodes.Items {
-			printPodMetrics(node, clientset, metricsClientset, &errorsList)
-			printNodeMetrics(node)
-			pterm.Println()
-		}
+		nodesToShow = nodes.Items
 	} else {
-		// Display metrics for the specified node
-		printPodMetrics(*foundNode, clientset, metricsClientset, &errorsList)
-		printNodeMetrics(*foundNode)
-		pterm.Println()
+		nodesToShow = []corev1.Node{*foundNode}
+	}
+
+	if printHeader {
+		pterm.DefaultHeader.WithFullWidth().Println("Cluster: " + clusterLabel(contextName))
 	}
 
+	if watchFlag {
+		return runWatch(ctx, clientset, metricsClientset, nodesToShow)
+	}
+
+	renderCtx, cancel := context.WithTimeout(ctx, timeoutFlag)
+	defer cancel()
+
+	var errorsList []error
+	listPods := func(name string) (*corev1.PodList, error) {
+		return clientset.CoreV1().Pods(podListNamespace()).List(renderCtx, metav1.ListOptions{
+			FieldSelector: podFieldSelector(name),
+			LabelSelector: selectorFlag,
+		})
+	}
+
+	pterm.Print(renderCluster(renderCtx, nodesToShow, listPods, metricsClientset, &errorsList))
+
 	if len(errorsList) > 0 {
 		pterm.Warning.Println("Error(s) :")
 		for i, err := range errorsList {
 			pterm.Printf("%d. %v\n", i+1, err)
 		}
 	}
+	return nil
+}
+
+// runStructuredOutput builds the --output=json|yaml|prom document for every context and
+// emits it: json/yaml are printed once, prom is either printed once or served over HTTP
+// when --listen is set.
+func runStructuredOutput(contexts []string, kubeconfigOverride string) error {
+	collect := func() ([]ClusterResult, error) {
+		return collectAllClusterResults(contexts, kubeconfigOverride)
+	}
+
+	switch outputFlag {
+	case OutputJSON:
+		clusters, err := collect()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(StructuredOutput{Clusters: clusters}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case OutputYAML:
+		clusters, err := collect()
+		if err != nil {
+			return err
+		}
+		data, err := yaml.Marshal(StructuredOutput{Clusters: clusters})
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	case OutputProm:
+		if listenFlag != "" {
+			return serveMetrics(listenFlag, collect)
+		}
+		clusters, err := collect()
+		if err != nil {
+			return err
+		}
+		fmt.Print(renderPrometheus(clusters))
+		return nil
+	default:
+		return fmt.Errorf("unknown --output %q", outputFlag)
+	}
+}
+
+// collectAllClusterResults builds the structured-output document for every context,
+// logging (but not aborting on) per-cluster failures the same way the table path does.
+func collectAllClusterResults(contexts []string, kubeconfigOverride string) ([]ClusterResult, error) {
+	var clusters []ClusterResult
+	for _, contextName := range contexts {
+		cluster, err := buildClusterResult(contextName, kubeconfigOverride)
+		if err != nil {
+			pterm.Error.Printf("Error on cluster %q: %v\n", clusterLabel(contextName), err)
+			continue
+		}
+		clusters = append(clusters, cluster)
+	}
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no cluster could be reached")
+	}
+	return clusters, nil
+}
+
+// buildClusterResult connects to a single cluster context and collects its structured
+// metrics, the --output=json|yaml|prom equivalent of runCluster's table rendering.
+func buildClusterResult(contextName, kubeconfigOverride string) (ClusterResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutFlag)
+	defer cancel()
+
+	config, err := loadKubeConfig(kubeconfigOverride, contextName)
+	if err != nil {
+		return ClusterResult{}, fmt.Errorf("loading Kubernetes configuration: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return ClusterResult{}, fmt.Errorf("creating Kubernetes client: %w", err)
+	}
+
+	metricsClientset, err := metricsv.NewForConfig(config)
+	if err != nil {
+		return ClusterResult{}, fmt.Errorf("creating Kubernetes metrics client: %w", err)
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return ClusterResult{}, fmt.Errorf("retrieving nodes: %w", err)
+	}
+
+	var foundNode *corev1.Node
+	for _, node := range nodes.Items {
+		if node.Name == nodeName {
+			foundNode = &node
+			break
+		}
+	}
+
+	nodesToShow := nodes.Items
+	if foundNode != nil {
+		nodesToShow = []corev1.Node{*foundNode}
+	}
+
+	listPods := func(name string) (*corev1.PodList, error) {
+		return clientset.CoreV1().Pods(podListNamespace()).List(ctx, metav1.ListOptions{
+			FieldSelector: podFieldSelector(name),
+			LabelSelector: selectorFlag,
+		})
+	}
+
+	// fetchPodResources only ever reports on the node ktop itself is running on, so it's
+	// dialed once for the whole cluster rather than once per node.
+	podResources, podResourcesOK := fetchPodResources(ctx)
+
+	var mu sync.Mutex
+	var errorsList []error
+	nodeResults := make([]NodeResult, len(nodesToShow))
+	// Shared by every node's per-pod metrics fallback, so --concurrency caps those Get()
+	// calls across all nodes together rather than once per node. The node goroutines
+	// themselves are limited separately by g.SetLimit.
+	sem := semaphore.NewWeighted(int64(concurrencyFlag))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrencyFlag)
+	for i, node := range nodesToShow {
+		i, node := i, node
+		g.Go(func() error {
+			var localErrors []error
+			rows := collectContainerRows(gctx, node, listPods, metricsClientset, sem, podResources, podResourcesOK, &localErrors)
+			nodeResults[i] = NodeResult{
+				Name:        node.Name,
+				Capacity:    ResourceValues{CPUMilli: node.Status.Capacity.Cpu().MilliValue(), MemoryBytes: node.Status.Capacity.Memory().Value()},
+				Allocatable: ResourceValues{CPUMilli: node.Status.Allocatable.Cpu().MilliValue(), MemoryBytes: node.Status.Allocatable.Memory().Value()},
+				Pods:        groupPodResults(rows),
+			}
+			mu.Lock()
+			errorsList = append(errorsList, localErrors...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	result := ClusterResult{Name: contextName, Nodes: nodeResults}
+
+	// Per-pod metrics errors (e.g. a pod mid-restart with no metrics yet) are routine and
+	// tolerated the same way the table path (runCluster/renderCluster) tolerates them: log
+	// them and still return whatever the cluster did produce, instead of discarding it.
+	for _, err := range errorsList {
+		pterm.Warning.Printf("Error on cluster %q: %v\n", clusterLabel(contextName), err)
+	}
+	return result, nil
+}
+
+// groupPodResults folds a flat list of container rows (one per container, pods
+// contiguous) into the pod-grouped shape the --output=json|yaml schema uses.
+func groupPodResults(rows []containerRow) []PodResult {
+	var pods []PodResult
+	var current *PodResult
+	for _, r := range rows {
+		if current == nil || current.Name != r.podName || current.Namespace != r.podNamespace {
+			pods = append(pods, PodResult{
+				Namespace:       r.podNamespace,
+				Name:            r.podName,
+				QOSClass:        r.qosClass,
+				HasNodeSelector: r.hasNodeSelector,
+				HasNodeAffinity: r.hasNodeAffinity,
+			})
+			current = &pods[len(pods)-1]
+		}
+		current.Containers = append(current.Containers, ContainerResult{
+			Name:           r.containerName,
+			Usage:          ResourceValues{CPUMilli: r.cpuUsage, MemoryBytes: r.memoryUsage},
+			Requests:       ResourceValues{CPUMilli: r.cpuRequest, MemoryBytes: r.memoryRequest},
+			Limits:         ResourceValues{CPUMilli: r.cpuLimit, MemoryBytes: r.memoryLimit},
+			SpotToleration: r.spotToleration == "true",
+			ExclusiveCPUs:  r.exclusiveCPUs,
+			DeviceIDs:      r.deviceIDs,
+		})
+	}
+	return pods
+}
+
+// renderPrometheus formats the collected clusters as Prometheus text exposition gauges,
+// labeled by cluster/node/namespace/pod/container.
+func renderPrometheus(clusters []ClusterResult) string {
+	var sb strings.Builder
+
+	writeGauge := func(name, help string, write func()) {
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+		sb.WriteString(fmt.Sprintf("# TYPE %s gauge\n", name))
+		write()
+	}
+
+	writeGauge("ktop_container_cpu_usage_millicores", "Container CPU usage in millicores", func() {
+		for _, cluster := range clusters {
+			for _, node := range cluster.Nodes {
+				for _, pod := range node.Pods {
+					for _, c := range pod.Containers {
+						sb.WriteString(fmt.Sprintf("ktop_container_cpu_usage_millicores{cluster=%q,node=%q,namespace=%q,pod=%q,container=%q} %d\n",
+							clusterLabel(cluster.Name), node.Name, pod.Namespace, pod.Name, c.Name, c.Usage.CPUMilli))
+					}
+				}
+			}
+		}
+	})
+
+	writeGauge("ktop_container_memory_usage_bytes", "Container memory usage in bytes", func() {
+		for _, cluster := range clusters {
+			for _, node := range cluster.Nodes {
+				for _, pod := range node.Pods {
+					for _, c := range pod.Containers {
+						sb.WriteString(fmt.Sprintf("ktop_container_memory_usage_bytes{cluster=%q,node=%q,namespace=%q,pod=%q,container=%q} %d\n",
+							clusterLabel(cluster.Name), node.Name, pod.Namespace, pod.Name, c.Name, c.Usage.MemoryBytes))
+					}
+				}
+			}
+		}
+	})
+
+	writeGauge("ktop_node_cpu_allocatable_millicores", "Node allocatable CPU in millicores", func() {
+		for _, cluster := range clusters {
+			for _, node := range cluster.Nodes {
+				sb.WriteString(fmt.Sprintf("ktop_node_cpu_allocatable_millicores{cluster=%q,node=%q} %d\n",
+					clusterLabel(cluster.Name), node.Name, node.Allocatable.CPUMilli))
+			}
+		}
+	})
+
+	writeGauge("ktop_node_memory_allocatable_bytes", "Node allocatable memory in bytes", func() {
+		for _, cluster := range clusters {
+			for _, node := range cluster.Nodes {
+				sb.WriteString(fmt.Sprintf("ktop_node_memory_allocatable_bytes{cluster=%q,node=%q} %d\n",
+					clusterLabel(cluster.Name), node.Name, node.Allocatable.MemoryBytes))
+			}
+		}
+	})
+
+	return sb.String()
+}
+
+// serveMetrics exposes /metrics over HTTP, re-collecting the clusters on every scrape so
+// ktop can double as a lightweight ad-hoc Prometheus exporter.
+func serveMetrics(addr string, collect func() ([]ClusterResult, error)) error {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		clusters, err := collect()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, renderPrometheus(clusters))
+	})
+	pterm.Info.Printf("Serving Prometheus metrics on %s/metrics\n", addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+// renderCluster renders the pod and node tables for every node passed in, concatenating
+// them the same way the one-shot and watch modes both present the cluster. Collection for
+// each node runs concurrently (bounded by --concurrency), while the concatenated output
+// stays in node order regardless of which node's fetch finishes first.
+func renderCluster(ctx context.Context, nodes []corev1.Node, listPods podLister, metricsClientset *metricsv.Clientset, errorsList *[]error) string {
+	// fetchPodResources only ever reports on the node ktop itself is running on, so it's
+	// dialed once for the whole render rather than once per node.
+	podResources, podResourcesOK := fetchPodResources(ctx)
+
+	var mu sync.Mutex
+	sections := make([]string, len(nodes))
+	// Shared by every node's per-pod metrics fallback, so --concurrency caps those Get()
+	// calls across all nodes together rather than once per node. The node goroutines
+	// themselves are limited separately by g.SetLimit.
+	sem := semaphore.NewWeighted(int64(concurrencyFlag))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrencyFlag)
+	for i, node := range nodes {
+		i, node := i, node
+		g.Go(func() error {
+			var localErrors []error
+			section := printPodMetrics(gctx, node, listPods, metricsClientset, sem, podResources, podResourcesOK, &localErrors)
+			section += "\n" + printNodeMetrics(node) + "\n\n"
+			sections[i] = section
+			mu.Lock()
+			*errorsList = append(*errorsList, localErrors...)
+			mu.Unlock()
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var sb strings.Builder
+	for _, section := range sections {
+		sb.WriteString(section)
+	}
+	return sb.String()
 }
 
-// printNodeMetrics displays performance metrics for a specified node.
-func printNodeMetrics(node corev1.Node) {
+// runWatch turns the one-shot render into a continuous top-like display: pods/nodes are
+// served from a SharedInformerFactory cache so each tick doesn't re-List() the cluster,
+// metrics are re-fetched every tick, and SIGINT/SIGTERM restore the terminal cleanly.
+func runWatch(ctx context.Context, clientset *kubernetes.Clientset, metricsClientset *metricsv.Clientset, nodesToShow []corev1.Node) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	nodeInformer := factory.Core().V1().Nodes()
+	podInformer := factory.Core().V1().Pods()
+	// Informer() registers each informer with the factory; Start only runs registered ones.
+	nodeSynced := nodeInformer.Informer().HasSynced
+	podSynced := podInformer.Informer().HasSynced
+
+	factory.Start(watchCtx.Done())
+	if !cache.WaitForCacheSync(watchCtx.Done(), nodeSynced, podSynced) {
+		return fmt.Errorf("failed to sync informer cache")
+	}
+
+	onlyNode := ""
+	if len(nodesToShow) == 1 {
+		onlyNode = nodesToShow[0].Name
+	}
+
+	listPods := func(name string) (*corev1.PodList, error) {
+		all, err := podInformer.Lister().List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		podList := &corev1.PodList{}
+		for _, pod := range all {
+			if pod.Spec.NodeName == name && matchesPodFilters(pod) {
+				podList.Items = append(podList.Items, *pod)
+			}
+		}
+		return podList, nil
+	}
+
+	area, err := pterm.DefaultArea.WithFullscreen().Start()
+	if err != nil {
+		return err
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	render := func() {
+		var errorsList []error
+		cachedNodes, err := nodeInformer.Lister().List(labels.Everything())
+		if err != nil {
+			errorsList = append(errorsList, err)
+		}
+
+		var nodes []corev1.Node
+		for _, node := range cachedNodes {
+			if onlyNode != "" && node.Name != onlyNode {
+				continue
+			}
+			nodes = append(nodes, *node)
+		}
+
+		tickCtx, cancel := context.WithTimeout(watchCtx, timeoutFlag)
+		content := renderCluster(tickCtx, nodes, listPods, metricsClientset, &errorsList)
+		cancel()
+		if len(errorsList) > 0 {
+			content += "Error(s) :\n"
+			for i, err := range errorsList {
+				content += pterm.Sprintf("%d. %v\n", i+1, err)
+			}
+		}
+		area.Update(content)
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	render()
+	for {
+		select {
+		case <-ticker.C:
+			render()
+		case <-sigCh:
+			area.Stop()
+			return nil
+		}
+	}
+}
+
+// printNodeMetrics renders performance metrics for a specified node and returns the
+// table as a string, so callers can either print it once or repaint it in watch mode.
+func printNodeMetrics(node corev1.Node) string {
 	// Initialize columns with headers
 	nodeTableData := pterm.TableData{
 		{"Node", "CPU Capacity", "CPU Allocatable", "Mem Capacity", "Mem Allocatable"},
@@ -153,46 +790,232 @@ func printNodeMetrics(node corev1.Node) {
 	}
 	nodeTableData = append(nodeTableData, totalRow)
 
-	pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(nodeTableData).Render()
+	rendered, _ := pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(nodeTableData).Srender()
+	return rendered
+}
+
+// containerRow holds the raw and derived metrics for a single container. The utilization
+// fields are computed once at collection time and used for sorting; the table's
+// percentage cells are formatted from the raw values.
+type containerRow struct {
+	podNamespace   string
+	podName        string
+	containerName  string
+	spotToleration string
+
+	qosClass        string
+	hasNodeSelector bool
+	hasNodeAffinity bool
+
+	cpuUsage, cpuRequest, cpuLimit           int64
+	memoryUsage, memoryRequest, memoryLimit int64
+
+	cpuNodeUtil, memNodeUtil     float64
+	cpuRequestUtil, cpuLimitUtil float64
+	memRequestUtil, memLimitUtil float64
+
+	// exclusiveCPUs/deviceIDs come from the kubelet PodResources API and are only
+	// populated (podResourcesAvailable true) when that socket is reachable.
+	podResourcesAvailable bool
+	exclusiveCPUs         string
+	deviceIDs             string
+}
+
+// percentOf returns numerator/denominator as a percentage string, or "-" when the
+// denominator is zero (no request/limit/capacity set).
+func percentOf(numerator, denominator int64) (float64, string) {
+	if denominator == 0 {
+		return 0, "-"
+	}
+	pct := float64(numerator) / float64(denominator) * 100
+	return pct, pterm.Sprintf("%.1f%%", pct)
+}
+
+// formatNodeSelAffin summarizes whether a pod constrains scheduling via nodeSelector
+// and/or node affinity, for the "Node Sel/Affin" column.
+func formatNodeSelAffin(hasSelector, hasAffinity bool) string {
+	switch {
+	case hasSelector && hasAffinity:
+		return "sel+affin"
+	case hasSelector:
+		return "sel"
+	case hasAffinity:
+		return "affin"
+	default:
+		return "-"
+	}
+}
+
+// orDash returns "-" for an empty string, matching percentOf's convention for "no data".
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
 }
 
-// printPodMetrics retrieves and displays performance metrics of pods for a specified node.
-func printPodMetrics(node corev1.Node, clientset *kubernetes.Clientset, metricsClientset *metricsv.Clientset, errorsList *[]error) {
-	// List all pods on the specified node
-	pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
+// podLister fetches the pods scheduled on a given node. One-shot mode backs it with a
+// direct clientset List(); watch mode backs it with an informer-cached lister so every
+// tick doesn't re-List() the whole cluster.
+type podLister func(nodeName string) (*corev1.PodList, error)
+
+// podListNamespace returns the namespace to pass to Pods(), honoring --namespace
+// (--all-namespaces, and the default, both mean "every namespace" to the API).
+func podListNamespace() string {
+	return namespaceFlag
+}
+
+// podFieldSelector combines the node filter with --field-selector, so callers don't have
+// to remember to AND the two together.
+func podFieldSelector(nodeName string) string {
+	nodeSelector := pterm.Sprintf("spec.nodeName=%s", nodeName)
+	if fieldSelectorFlag == "" {
+		return nodeSelector
+	}
+	return nodeSelector + "," + fieldSelectorFlag
+}
+
+// matchesPodFilters reports whether a pod satisfies --namespace/--selector, for filtering
+// the informer cache in watch mode where those can't be pushed to the API server.
+// --field-selector is rejected alongside --watch at startup rather than evaluated here.
+func matchesPodFilters(pod *corev1.Pod) bool {
+	if namespaceFlag != "" && pod.Namespace != namespaceFlag {
+		return false
+	}
+	if selectorFlag != "" {
+		selector, err := labels.Parse(selectorFlag)
+		if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchPodMetrics returns the metrics-server data for every pod on the node, preferring a
+// single List() call with a nodeName field selector over one Get() per pod. Not every
+// metrics-server supports that field selector, so only a failed List falls back to one
+// Get() per pod, bounded by sem — the same semaphore every other node's fallback acquires
+// from, so --concurrency caps these Get() calls across all nodes together instead of being
+// handed out again to each node independently. A List
+// that succeeds but comes back empty means the selector is supported and metrics just
+// haven't been scraped yet, so it's trusted as-is instead of being retried pod-by-pod
+// (which would otherwise 404 once per pod and pile spurious errors onto a routine,
+// transient condition).
+func fetchPodMetrics(ctx context.Context, node corev1.Node, pods []corev1.Pod, metricsClientset *metricsv.Clientset, sem *semaphore.Weighted, errorsList *[]error) map[string]*metricsapi.PodMetrics {
+	metricsByPod := make(map[string]*metricsapi.PodMetrics, len(pods))
+
+	if bulk, err := metricsClientset.MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{
 		FieldSelector: pterm.Sprintf("spec.nodeName=%s", node.Name),
-	})
+	}); err == nil {
+		for i := range bulk.Items {
+			pm := bulk.Items[i]
+			metricsByPod[pm.Namespace+"/"+pm.Name] = &pm
+		}
+		return metricsByPod
+	}
+
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+
+	for _, pod := range pods {
+		pod := pod
+		g.Go(func() error {
+			if err := sem.Acquire(gctx, 1); err != nil {
+				return err
+			}
+			defer sem.Release(1)
+			podMetrics, err := metricsClientset.MetricsV1beta1().PodMetricses(pod.Namespace).Get(gctx, pod.Name, metav1.GetOptions{})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				*errorsList = append(*errorsList, err)
+				return nil
+			}
+			metricsByPod[pod.Namespace+"/"+pod.Name] = podMetrics
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return metricsByPod
+}
+
+// podResourceInfo holds the exclusive CPU set and device IDs the kubelet allocated to one
+// container, reported by the kubelet PodResources API.
+type podResourceInfo struct {
+	exclusiveCPUs string
+	deviceIDs     string
+}
+
+// fetchPodResources queries the local kubelet's PodResources gRPC API for exclusive CPU
+// sets and device IDs, keyed by "podUID/containerName". It only ever reports on the node
+// ktop itself is running on; the second return value is false when the socket can't be
+// dialed (e.g. ktop isn't running as a DaemonSet with the socket mounted), so callers can
+// silently omit those columns rather than failing the whole run. Called once per render
+// (not once per node): in a multi-node view the "Exclusive CPUs"/"Devices" columns still
+// show up for every node's table, but the lookup can only ever match pods colocated with
+// ktop, so every other node's rows are expected to permanently read "-".
+func fetchPodResources(ctx context.Context) (map[string]podResourceInfo, bool) {
+	conn, err := grpc.DialContext(ctx, "unix://"+podResourcesSocket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
 	if err != nil {
-		*errorsList = append(*errorsList, err)
+		return nil, false
 	}
+	defer conn.Close()
 
-	// Initialize the progress bar
-	bar, _ := pterm.DefaultProgressbar.WithTotal(len(pods.Items)).WithTitle("Running").WithRemoveWhenDone().Start()
+	resp, err := podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, false
+	}
 
-	// Create a variable to alternate row colors in tables
-	var colorgrid = false
+	info := make(map[string]podResourceInfo)
+	for _, pod := range resp.PodResources {
+		for _, c := range pod.Containers {
+			var cpus []string
+			for _, id := range c.CpuIds {
+				cpus = append(cpus, strconv.FormatInt(id, 10))
+			}
+			var devices []string
+			for _, d := range c.Devices {
+				devices = append(devices, d.DeviceIds...)
+			}
+			if len(cpus) == 0 && len(devices) == 0 {
+				continue
+			}
+			info[pod.PodUid+"/"+c.Name] = podResourceInfo{
+				exclusiveCPUs: strings.Join(cpus, ","),
+				deviceIDs:     strings.Join(devices, ","),
+			}
+		}
+	}
+	return info, true
+}
 
-	// Create an array to store pod data
-	var podTableData pterm.TableData
-	var totalTableData pterm.TableData
+// collectContainerRows fetches pods and their metrics for a node and flattens them into
+// one containerRow per container, computing utilization along the way. It is shared by
+// the table renderer and the --output=json|yaml|prom structured output. Rows are sorted
+// deterministically by namespace/pod/container so concurrent collection doesn't reorder
+// the table between runs. sem bounds the per-pod metrics Get() fallback across every
+// node's collection, not just this one. podResources/podResourcesOK are collected once for the whole render
+// (fetchPodResources only ever describes ktop's own node), not re-dialed per node.
+func collectContainerRows(ctx context.Context, node corev1.Node, listPods podLister, metricsClientset *metricsv.Clientset, sem *semaphore.Weighted, podResources map[string]podResourceInfo, podResourcesOK bool, errorsList *[]error) []containerRow {
+	podList, err := listPods(node.Name)
+	if err != nil {
+		*errorsList = append(*errorsList, err)
+		podList = &corev1.PodList{}
+	}
 
-	// Variables for cumulative metrics
-	var totalCPUUsage, totalCPURequest, totalCPULimit int64
-	var totalMemoryUsage, totalMemoryRequest, totalMemoryLimit int64
+	metricsByPod := fetchPodMetrics(ctx, node, podList.Items, metricsClientset, sem, errorsList)
 
-	// Initialize columns with headers
-	podTableData = append(podTableData, []string{"Pods on " + node.Name, "Container", "CPU Usage", "CPU Request", "CPU Limit", "Mem Usage", "Mem Request", "Mem Limit", "Spot Tolerance"})
-	totalTableData = append(totalTableData, []string{"Pod total capacity on Node", "CPU Usage", "CPU Request", "Mem Usage", "Mem Request"})
+	// Node capacity used as the denominator for the node-utilization columns
+	nodeCPUAllocatable := node.Status.Allocatable.Cpu().MilliValue()
+	nodeMemoryAllocatable := node.Status.Allocatable.Memory().Value()
 
 	// Get performance metrics for each pod on this node
-	for _, pod := range pods.Items {
-		// Increment the progress bar
-		bar.Increment()
-
-		// Get performance metrics of the pod
-		podMetrics, err := metricsClientset.MetricsV1beta1().PodMetricses(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
-		if err != nil {
-			*errorsList = append(*errorsList, err)
+	var rows []containerRow
+	for _, pod := range podList.Items {
+		podMetrics, ok := metricsByPod[pod.Namespace+"/"+pod.Name]
+		if !ok {
 			continue
 		}
 
@@ -219,7 +1042,6 @@ func printPodMetrics(node corev1.Node, clientset *kubernetes.Clientset, metricsC
 			requests := containerSpec.Resources.Requests
 			limits := containerSpec.Resources.Limits
 
-			containerName := containerMetrics.Name
 			cpuUsage := usage.Cpu().MilliValue()
 			cpuRequest = requests.Cpu().MilliValue()
 			cpuLimit := limits.Cpu().MilliValue()
@@ -238,47 +1060,133 @@ func printPodMetrics(node corev1.Node, clientset *kubernetes.Clientset, metricsC
 				}
 			}
 
-			if colorgrid {
-				// Add data to the table row, including spot tolerance
-				row := []string{
-					pterm.BgDarkGray.Sprint(pod.Name),
-					pterm.BgDarkGray.Sprint(containerName),
-					pterm.BgDarkGray.Sprintf("%d m", cpuUsage),
-					pterm.BgDarkGray.Sprintf("%d m", cpuRequest),
-					pterm.BgDarkGray.Sprintf("%d m", cpuLimit),
-					pterm.BgDarkGray.Sprint(units.BytesSize(float64(memoryUsage))),
-					pterm.BgDarkGray.Sprint(units.BytesSize(float64(memoryRequest))),
-					pterm.BgDarkGray.Sprint(units.BytesSize(float64(memoryLimit))),
-					pterm.BgDarkGray.Sprint(spotToleration),
-				}
-				podTableData = append(podTableData, row)
-			} else {
-				// Add data to the table row without color
-				row := []string{
-					pod.Name,
-					containerName,
-					pterm.Sprintf("%d m", cpuUsage),
-					pterm.Sprintf("%d m", cpuRequest),
-					pterm.Sprintf("%d m", cpuLimit),
-					units.BytesSize(float64(memoryUsage)),
-					units.BytesSize(float64(memoryRequest)),
-					units.BytesSize(float64(memoryLimit)),
-					spotToleration,
+			row := containerRow{
+				podNamespace:    pod.Namespace,
+				podName:         pod.Name,
+				containerName:   containerMetrics.Name,
+				spotToleration:  spotToleration,
+				qosClass:        string(pod.Status.QOSClass),
+				hasNodeSelector: len(pod.Spec.NodeSelector) > 0,
+				hasNodeAffinity: pod.Spec.Affinity != nil && pod.Spec.Affinity.NodeAffinity != nil,
+				cpuUsage:        cpuUsage,
+				cpuRequest:      cpuRequest,
+				cpuLimit:        cpuLimit,
+				memoryUsage:     memoryUsage,
+				memoryRequest:   memoryRequest,
+				memoryLimit:     memoryLimit,
+			}
+			row.cpuNodeUtil, _ = percentOf(cpuUsage, nodeCPUAllocatable)
+			row.memNodeUtil, _ = percentOf(memoryUsage, nodeMemoryAllocatable)
+			row.cpuRequestUtil, _ = percentOf(cpuUsage, cpuRequest)
+			row.cpuLimitUtil, _ = percentOf(cpuUsage, cpuLimit)
+			row.memRequestUtil, _ = percentOf(memoryUsage, memoryRequest)
+			row.memLimitUtil, _ = percentOf(memoryUsage, memoryLimit)
+
+			if podResourcesOK {
+				row.podResourcesAvailable = true
+				if res, ok := podResources[string(pod.UID)+"/"+containerMetrics.Name]; ok {
+					row.exclusiveCPUs = res.exclusiveCPUs
+					row.deviceIDs = res.deviceIDs
 				}
-				podTableData = append(podTableData, row)
 			}
+			rows = append(rows, row)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].podNamespace != rows[j].podNamespace {
+			return rows[i].podNamespace < rows[j].podNamespace
+		}
+		if rows[i].podName != rows[j].podName {
+			return rows[i].podName < rows[j].podName
+		}
+		return rows[i].containerName < rows[j].containerName
+	})
+
+	return rows
+}
+
+// printPodMetrics retrieves and renders performance metrics of pods for a specified node,
+// returning the table as a string rather than printing it directly.
+func printPodMetrics(ctx context.Context, node corev1.Node, listPods podLister, metricsClientset *metricsv.Clientset, sem *semaphore.Weighted, podResources map[string]podResourceInfo, podResourcesOK bool, errorsList *[]error) string {
+	rows := collectContainerRows(ctx, node, listPods, metricsClientset, sem, podResources, podResourcesOK, errorsList)
+	return renderPodTable(node, rows)
+}
+
+// renderPodTable formats already-collected container rows into the pod table for a node.
+func renderPodTable(node corev1.Node, rows []containerRow) string {
+	// Variables for cumulative metrics
+	var totalCPUUsage, totalCPURequest, totalCPULimit int64
+	var totalMemoryUsage, totalMemoryRequest, totalMemoryLimit int64
+	for _, r := range rows {
+		totalCPUUsage += r.cpuUsage
+		totalCPURequest += r.cpuRequest
+		totalCPULimit += r.cpuLimit
+		totalMemoryUsage += r.memoryUsage
+		totalMemoryRequest += r.memoryRequest
+		totalMemoryLimit += r.memoryLimit
+	}
 
-			// Toggle the colorgrid value
-			colorgrid = !colorgrid
+	// Node capacity used as the denominator for the node-utilization columns
+	nodeCPUAllocatable := node.Status.Allocatable.Cpu().MilliValue()
+	nodeMemoryAllocatable := node.Status.Allocatable.Memory().Value()
 
-			// Add to the totals
-			totalCPUUsage += cpuUsage
-			totalCPURequest += cpuRequest
-			totalCPULimit += cpuLimit
-			totalMemoryUsage += memoryUsage
-			totalMemoryRequest += memoryRequest
-			totalMemoryLimit += memoryLimit
+	sortContainerRows(rows)
+
+	// Exclusive CPU set/device ID columns only make sense when ktop could reach the
+	// kubelet PodResources socket; omit them entirely otherwise.
+	podResourcesAvailable := len(rows) > 0 && rows[0].podResourcesAvailable
+
+	// Initialize columns with headers
+	header := []string{"Pods on " + node.Name, "Container", "CPU Usage", "CPU Request", "CPU Limit", "Mem Usage", "Mem Request", "Mem Limit", "Spot Tolerance", "QoS", "Node Sel/Affin"}
+	if showUtilization {
+		header = append(header, "CPU Node %", "Mem Node %", "CPU Req %", "CPU Limit %", "Mem Req %", "Mem Limit %")
+	}
+	if podResourcesAvailable {
+		header = append(header, "Exclusive CPUs", "Devices")
+	}
+	podTableData := pterm.TableData{header}
+	totalTableData := pterm.TableData{{"Pod total capacity on Node", "CPU Usage", "CPU Request", "Mem Usage", "Mem Request"}}
+
+	// Create a variable to alternate row colors in tables
+	var colorgrid = false
+	for _, r := range rows {
+		_, cpuNodeUtilStr := percentOf(r.cpuUsage, nodeCPUAllocatable)
+		_, memNodeUtilStr := percentOf(r.memoryUsage, nodeMemoryAllocatable)
+		_, cpuRequestUtilStr := percentOf(r.cpuUsage, r.cpuRequest)
+		_, cpuLimitUtilStr := percentOf(r.cpuUsage, r.cpuLimit)
+		_, memRequestUtilStr := percentOf(r.memoryUsage, r.memoryRequest)
+		_, memLimitUtilStr := percentOf(r.memoryUsage, r.memoryLimit)
+
+		row := []string{
+			r.podName,
+			r.containerName,
+			pterm.Sprintf("%d m", r.cpuUsage),
+			pterm.Sprintf("%d m", r.cpuRequest),
+			pterm.Sprintf("%d m", r.cpuLimit),
+			units.BytesSize(float64(r.memoryUsage)),
+			units.BytesSize(float64(r.memoryRequest)),
+			units.BytesSize(float64(r.memoryLimit)),
+			r.spotToleration,
+			r.qosClass,
+			formatNodeSelAffin(r.hasNodeSelector, r.hasNodeAffinity),
+		}
+		if showUtilization {
+			row = append(row, cpuNodeUtilStr, memNodeUtilStr, cpuRequestUtilStr, cpuLimitUtilStr, memRequestUtilStr, memLimitUtilStr)
 		}
+		if podResourcesAvailable {
+			row = append(row, orDash(r.exclusiveCPUs), orDash(r.deviceIDs))
+		}
+
+		if colorgrid {
+			for i, cell := range row {
+				row[i] = pterm.BgDarkGray.Sprint(cell)
+			}
+		}
+		podTableData = append(podTableData, row)
+
+		// Toggle the colorgrid value
+		colorgrid = !colorgrid
 	}
 
 	// Format the totals with appropriate units
@@ -310,23 +1218,112 @@ func printPodMetrics(node corev1.Node, clientset *kubernetes.Clientset, metricsC
 		formattedTotalMemoryRequest,
 		formattedTotalMemoryLimit,
 		"",
+		"",
+		"",
+	}
+	if showUtilization {
+		_, cpuNodeUtilStr := percentOf(totalCPUUsage, nodeCPUAllocatable)
+		_, memNodeUtilStr := percentOf(totalMemoryUsage, nodeMemoryAllocatable)
+		_, cpuRequestUtilStr := percentOf(totalCPUUsage, totalCPURequest)
+		_, cpuLimitUtilStr := percentOf(totalCPUUsage, totalCPULimit)
+		_, memRequestUtilStr := percentOf(totalMemoryUsage, totalMemoryRequest)
+		_, memLimitUtilStr := percentOf(totalMemoryUsage, totalMemoryLimit)
+		totalPods = append(totalPods, cpuNodeUtilStr, memNodeUtilStr, cpuRequestUtilStr, cpuLimitUtilStr, memRequestUtilStr, memLimitUtilStr)
+	}
+	if podResourcesAvailable {
+		totalPods = append(totalPods, "", "")
 	}
 	podTableData = append(podTableData, totalPods)
 
-	if nodeName == "" {
-		pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(totalTableData).Render()
+	// --show-utilization/--sort-by are about spotting hot containers across the whole
+	// cluster, so they force the detailed per-container table even in the default
+	// whole-cluster view; otherwise that view stays the compact per-node summary.
+	var rendered string
+	if nodeName == "" && !showUtilization && sortBy == "" {
+		rendered, _ = pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(totalTableData).Srender()
 	} else {
-		pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(podTableData).Render()
+		rendered, _ = pterm.DefaultTable.WithHeaderRowSeparator("─").WithBoxed().WithHasHeader().WithData(podTableData).Srender()
 	}
+	return rendered
 }
 
-func loadKubeConfig() (*rest.Config, error) {
-	home := homedir.HomeDir()
-	configPath := filepath.Join(home, ".kube", "config")
+// sortContainerRows orders rows by the utilization metric selected via --sort-by,
+// highest utilization first. It is a no-op when --sort-by is unset or unrecognized.
+func sortContainerRows(rows []containerRow) {
+	var less func(i, j int) bool
+	switch sortBy {
+	case SortByCPUNodeUtil:
+		less = func(i, j int) bool { return rows[i].cpuNodeUtil > rows[j].cpuNodeUtil }
+	case SortByMemNodeUtil:
+		less = func(i, j int) bool { return rows[i].memNodeUtil > rows[j].memNodeUtil }
+	case SortByCPULimitUtil:
+		less = func(i, j int) bool { return rows[i].cpuLimitUtil > rows[j].cpuLimitUtil }
+	default:
+		return
+	}
+	sort.SliceStable(rows, less)
+}
+
+// loadKubeConfig resolves the config to talk to a cluster: in-cluster config when ktop is
+// itself running as a Pod (KUBERNETES_SERVICE_HOST set), otherwise a kubeconfig resolved
+// via $KUBECONFIG (colon-separated) or --kubeconfig, honoring --context.
+func loadKubeConfig(kubeconfigOverride, contextName string) (*rest.Config, error) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if config, err := rest.InClusterConfig(); err == nil {
+			return config, nil
+		}
+	}
+
+	overrides := &clientcmd.ConfigOverrides{}
+	if contextName != "" {
+		overrides.CurrentContext = contextName
+	}
 
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(kubeconfigLoadingRules(kubeconfigOverride), overrides).ClientConfig()
+}
+
+// kubeconfigLoadingRules builds the loading rules clientcmd uses to find a kubeconfig,
+// preferring --kubeconfig, then $KUBECONFIG (colon-separated on Unix), then ~/.kube/config.
+func kubeconfigLoadingRules(kubeconfigOverride string) *clientcmd.ClientConfigLoadingRules {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	switch {
+	case kubeconfigOverride != "":
+		loadingRules.Precedence = filepath.SplitList(kubeconfigOverride)
+	case os.Getenv("KUBECONFIG") != "":
+		loadingRules.Precedence = filepath.SplitList(os.Getenv("KUBECONFIG"))
+	default:
+		loadingRules.Precedence = []string{filepath.Join(homedir.HomeDir(), ".kube", "config")}
+	}
+	return loadingRules
+}
+
+// resolveContexts turns --context into the list of kubeconfig contexts to fan out across:
+// "" means the current/in-cluster context, "all" means every context in the kubeconfig,
+// and a comma-separated list means exactly those contexts.
+func resolveContexts(contextFlag, kubeconfigOverride string) ([]string, error) {
+	switch {
+	case contextFlag == "":
+		return []string{""}, nil
+	case contextFlag == "all":
+		return listKubeconfigContexts(kubeconfigOverride)
+	case strings.Contains(contextFlag, ","):
+		return strings.Split(contextFlag, ","), nil
+	default:
+		return []string{contextFlag}, nil
+	}
+}
+
+// listKubeconfigContexts returns every context name defined in the resolved kubeconfig.
+func listKubeconfigContexts(kubeconfigOverride string) ([]string, error) {
+	rawConfig, err := kubeconfigLoadingRules(kubeconfigOverride).Load()
 	if err != nil {
 		return nil, err
 	}
-	return config, nil
+
+	contexts := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
 }